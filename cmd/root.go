@@ -20,19 +20,36 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/aquasecurity/go-pep440-version"
 	"github.com/pelletier/go-toml"
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
 
+var (
+	fix           bool
+	dryRun        bool
+	lockfilePaths []string
+	audit         bool
+	offline       bool
+	pyprojectPath string
+)
+
 var rootCmd = &cobra.Command{
 	Use: "sync-versions-poetry",
 	Run: func(cmd *cobra.Command, args []string) {
@@ -40,26 +57,96 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			panic(err)
 		}
-		data, err := loadPreCommitConfig(file)
+		root, err := loadPreCommitConfig(file)
 		if err != nil {
 			panic(err)
 		}
-		lockfile, err := loadPoetryLock(os.DirFS("."))
+		var data preCommitConfig
+		if err := root.Decode(&data); err != nil {
+			panic(err)
+		}
+		checks, err := resolveChecks(os.DirFS("."), data, lockfilePaths, args, pyprojectPath)
 		if err != nil {
 			panic(err)
 		}
-		if len(args) == 0 {
-			args = []string{"black", "flake8", "isort", "mypy"}
+		if fix || dryRun {
+			changed := false
+			for _, check := range checks {
+				if fixVersions(root, check.lockfile, check.hookIds, check.ignore) {
+					changed = true
+				}
+			}
+			if !changed {
+				return
+			}
+			fixedFile, err := marshalPreCommitConfig(root)
+			if err != nil {
+				panic(err)
+			}
+			if dryRun {
+				printDiff(file, fixedFile)
+				os.Exit(1)
+			}
+			if err := os.WriteFile(".pre-commit-config.yaml", fixedFile, 0666); err != nil {
+				panic(err)
+			}
+			os.Exit(1)
+		}
+		var problems []string
+		for _, check := range checks {
+			problems = append(problems, checkVersions(filterIgnored(data, check.ignore), check.lockfile, check.hookIds)...)
 		}
-		if problems := checkVersions(data, lockfile, args); len(problems) > 0 {
+		if len(problems) > 0 {
 			for _, problem := range problems {
 				fmt.Println(problem)
 			}
 			os.Exit(1)
 		}
+		if audit {
+			var auditProblems []string
+			for _, check := range checks {
+				checkProblems, err := auditVersions(filterIgnored(data, check.ignore), check.hookIds, offline)
+				if err != nil {
+					panic(err)
+				}
+				auditProblems = append(auditProblems, checkProblems...)
+			}
+			if len(auditProblems) > 0 {
+				for _, problem := range auditProblems {
+					fmt.Println(problem)
+				}
+				os.Exit(1)
+			}
+		}
+		var pyprojectProblems []string
+		for _, check := range checks {
+			if check.pyproject == "" {
+				continue
+			}
+			constraints, err := loadPyprojectConstraints(os.DirFS("."), check.pyproject)
+			if err != nil {
+				panic(err)
+			}
+			pyprojectProblems = append(pyprojectProblems, checkPyprojectConstraints(filterIgnored(data, check.ignore), check.hookIds, constraints)...)
+		}
+		if len(pyprojectProblems) > 0 {
+			for _, problem := range pyprojectProblems {
+				fmt.Println(problem)
+			}
+			os.Exit(1)
+		}
 	},
 }
 
+func init() {
+	rootCmd.Flags().BoolVarP(&fix, "fix", "w", false, "rewrite .pre-commit-config.yaml in place so that additional_dependencies match the lockfile; exits 1 if any change was made")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print a diff of the changes --fix would make, without writing them; exits 1 if there is a diff")
+	rootCmd.Flags().StringArrayVar(&lockfilePaths, "lockfile", nil, "path to a lockfile to check against (repeatable); format is detected from the filename; auto-detected in the current directory when omitted")
+	rootCmd.Flags().BoolVar(&audit, "audit", false, "after a successful version check, query OSV.dev for known vulnerabilities in the pinned dependencies")
+	rootCmd.Flags().BoolVar(&offline, "offline", false, "with --audit, use only cached OSV.dev results and skip the network")
+	rootCmd.Flags().StringVar(&pyprojectPath, "pyproject", "", "also cross-check additional_dependencies pins against the constraints declared in this pyproject.toml")
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -73,21 +160,267 @@ func readPreCommitFile(fsys fs.FS) (file []byte, err error) {
 	return
 }
 
+type preCommitHook struct {
+	Id                     string
+	AdditionalDependencies []string `yaml:"additional_dependencies"`
+}
+
+type preCommitRepo struct {
+	Hooks []preCommitHook
+}
+
 type preCommitConfig struct {
-	Repos []struct {
-		Hooks []struct {
-			Id                     string
-			AdditionalDependencies []string `yaml:"additional_dependencies"`
+	Repos []preCommitRepo
+}
+
+// Parse the contents of a .pre-commit-config.yaml into a yaml.Node document tree. Keeping the
+// raw node tree (rather than decoding straight into preCommitConfig) lets fixVersions() rewrite
+// individual scalar nodes in place, so that comments and formatting elsewhere in the file survive
+// a --fix/--dry-run run unchanged. Callers that only need the parsed data should Decode() the
+// returned node into a preCommitConfig.
+func loadPreCommitConfig(data []byte) (root *yaml.Node, err error) {
+	root = &yaml.Node{}
+	err = yaml.Unmarshal(data, root)
+	return
+}
+
+// marshalPreCommitConfig serializes root back to YAML using a 2-space indent, matching the style
+// pre-commit's own templates (and this repo's fixtures) use. yaml.Marshal defaults to a 4-space
+// indent and would reflow every sequence in the file regardless of how it was originally written,
+// which defeats the point of editing the node tree in place rather than re-encoding from scratch.
+func marshalPreCommitConfig(root *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// printDiff prints a unified diff between the original and fixed contents of .pre-commit-config.yaml.
+func printDiff(original, fixed []byte) {
+	diff := difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(original)),
+		B:        difflib.SplitLines(string(fixed)),
+		FromFile: ".pre-commit-config.yaml",
+		ToFile:   ".pre-commit-config.yaml (fixed)",
+		Context:  3,
+	}
+	text, err := difflib.GetUnifiedDiffString(diff)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(text)
+}
+
+// LockSource is anything that can report which version of a named package is locked. It
+// abstracts over the various Python lockfile formats (poetry.lock, pdm.lock, uv.lock,
+// Pipfile.lock, a fully-pinned requirements.txt, ...) so that the rest of the tool doesn't need
+// to care which one it's dealing with.
+type LockSource interface {
+	// LockedVersion returns the version locked for the named package, and whether it was found.
+	LockedVersion(name string) (version string, ok bool)
+}
+
+// lockSources queries a list of LockSources in order, returning the first match. This is what
+// backs a repeated --lockfile flag.
+type lockSources []LockSource
+
+func (sources lockSources) LockedVersion(name string) (version string, ok bool) {
+	for _, source := range sources {
+		if version, ok = source.LockedVersion(name); ok {
+			return
+		}
+	}
+	return "", false
+}
+
+// knownLockfiles are the lockfile basenames that loadLockSources() will look for when no
+// --lockfile flags are given, in order of preference.
+var knownLockfiles = []string{"poetry.lock", "pdm.lock", "uv.lock", "Pipfile.lock", "requirements.txt"}
+
+// loadLockSources loads a LockSource for each of paths, auto-detecting its format from its
+// basename. When paths is empty, it looks for whichever well-known lockfile filename is
+// present in fsys and uses that, falling back to poetry.lock for backwards compatibility.
+func loadLockSources(fsys fs.FS, paths []string) (sources lockSources, err error) {
+	if len(paths) == 0 {
+		for _, name := range knownLockfiles {
+			if _, statErr := fs.Stat(fsys, name); statErr == nil {
+				paths = []string{name}
+				break
+			}
+		}
+		if len(paths) == 0 {
+			paths = []string{"poetry.lock"}
 		}
 	}
+	for _, path := range paths {
+		source, err := loadLockSource(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return
+}
+
+// loadLockSource loads a single LockSource from path, dispatching on its basename.
+func loadLockSource(fsys fs.FS, path string) (LockSource, error) {
+	switch name := pathBase(path); {
+	case name == "poetry.lock":
+		return loadPoetryLockFile(fsys, path)
+	case name == "pdm.lock":
+		return loadPdmLockFile(fsys, path)
+	case name == "uv.lock":
+		return loadUvLockFile(fsys, path)
+	case name == "Pipfile.lock":
+		return loadPipfileLockFile(fsys, path)
+	case strings.HasSuffix(name, ".txt"):
+		return loadRequirementsTxtFile(fsys, path)
+	default:
+		return nil, fmt.Errorf("%v: unrecognized lockfile format", path)
+	}
+}
+
+// pathBase returns the last path element, as a simplified path.Base() that works for both
+// slash-separated fs.FS paths and (on Windows) backslash-separated ones from --lockfile.
+func pathBase(p string) string {
+	if idx := strings.LastIndexAny(p, `/\`); idx != -1 {
+		return p[idx+1:]
+	}
+	return p
 }
 
-// Parse the contents of a .pre-commit-config.yaml.
-func loadPreCommitConfig(data []byte) (config preCommitConfig, err error) {
-	err = yaml.Unmarshal(data, &config)
+// configFileName is the repo-level config file that declares which hooks to check against which
+// lockfiles, overriding the built-in defaults.
+const configFileName = ".sync-versions-poetry.toml"
+
+// checkConfig is one [[check]] entry of a .sync-versions-poetry.toml: which hook(s) to check,
+// against which lockfile, optionally ignoring some dependency names.
+type checkConfig struct {
+	HookID    string   `toml:"hook_id"`
+	Lockfile  string   `toml:"lockfile"`
+	Pyproject string   `toml:"pyproject"`
+	Ignore    []string `toml:"ignore"`
+}
+
+type syncVersionsConfig struct {
+	Check []checkConfig `toml:"check"`
+}
+
+// loadConfigFile reads and parses .sync-versions-poetry.toml. When the file doesn't exist, it
+// returns a zero-value config and no error, so callers can fall back to the built-in defaults.
+func loadConfigFile(fsys fs.FS) (config syncVersionsConfig, err error) {
+	data, err := fs.ReadFile(fsys, configFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return syncVersionsConfig{}, nil
+	}
+	if err != nil {
+		return
+	}
+	err = toml.Unmarshal(data, &config)
 	return
 }
 
+// resolvedCheck is one hook selection, paired with the lockfile, ignore list and (optionally) the
+// pyproject.toml to check it against, ready to hand to checkVersions/fixVersions/auditVersions/
+// checkPyprojectConstraints. pyproject is empty when no pyproject.toml cross-check applies.
+type resolvedCheck struct {
+	hookIds   []string
+	lockfile  LockSource
+	ignore    []string
+	pyproject string
+}
+
+// resolveChecks works out what to check: if .sync-versions-poetry.toml declares any [[check]]
+// entries (and the user didn't explicitly name hooks on the command line), one resolvedCheck is
+// produced per entry, each with its own lockfile, ignore list and pyproject.toml. Otherwise, the
+// legacy behaviour applies: a single resolvedCheck covering the given (or default) hook IDs
+// against the lockfile(s) selected by --lockfile and the pyproject.toml selected by --pyproject.
+func resolveChecks(fsys fs.FS, data preCommitConfig, lockfilePaths []string, hookIds []string, pyprojectPath string) ([]resolvedCheck, error) {
+	config, err := loadConfigFile(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Check) == 0 || len(hookIds) > 0 {
+		if len(hookIds) == 0 {
+			hookIds = []string{"black", "flake8", "isort", "mypy"}
+		}
+		lockfile, err := loadLockSources(fsys, lockfilePaths)
+		if err != nil {
+			return nil, err
+		}
+		return []resolvedCheck{{hookIds: hookIds, lockfile: lockfile, pyproject: pyprojectPath}}, nil
+	}
+	checks := make([]resolvedCheck, len(config.Check))
+	for i, check := range config.Check {
+		paths := lockfilePaths
+		if check.Lockfile != "" {
+			paths = []string{check.Lockfile}
+		}
+		pyproject := pyprojectPath
+		if check.Pyproject != "" {
+			pyproject = check.Pyproject
+		}
+		lockfile, err := loadLockSources(fsys, paths)
+		if err != nil {
+			return nil, err
+		}
+		checks[i] = resolvedCheck{hookIds: matchingHookIds(data, check.HookID), lockfile: lockfile, ignore: check.Ignore, pyproject: pyproject}
+	}
+	return checks, nil
+}
+
+// matchingHookIds returns the IDs of hooks in config whose ID matches pattern, which may be an
+// exact hook ID or a glob (as accepted by path.Match). Matching is normalized, so "flake8*"
+// matches both "flake8-docstrings" and "flake8_docstrings".
+func matchingHookIds(config preCommitConfig, pattern string) (ids []string) {
+	normalizedPattern := normalizeName(pattern)
+	seen := make(map[string]bool)
+	for _, repo := range config.Repos {
+		for _, hook := range repo.Hooks {
+			if seen[hook.Id] {
+				continue
+			}
+			if matched, _ := path.Match(normalizedPattern, normalizeName(hook.Id)); matched {
+				seen[hook.Id] = true
+				ids = append(ids, hook.Id)
+			}
+		}
+	}
+	return
+}
+
+// filterIgnored returns a copy of config with any additional_dependencies entry naming one of the
+// ignored packages removed.
+func filterIgnored(config preCommitConfig, ignore []string) preCommitConfig {
+	if len(ignore) == 0 {
+		return config
+	}
+	normalizedIgnore := normalizeNames(ignore)
+	filtered := preCommitConfig{Repos: make([]preCommitRepo, len(config.Repos))}
+	for i, repo := range config.Repos {
+		filteredRepo := preCommitRepo{Hooks: make([]preCommitHook, len(repo.Hooks))}
+		for j, hook := range repo.Hooks {
+			filteredHook := preCommitHook{Id: hook.Id}
+			for _, depspec := range hook.AdditionalDependencies {
+				if matches := pat.FindStringSubmatch(strings.TrimSpace(depspec)); matches != nil &&
+					slices.Contains(normalizedIgnore, normalizeName(matches[1])) {
+					continue
+				}
+				filteredHook.AdditionalDependencies = append(filteredHook.AdditionalDependencies, depspec)
+			}
+			filteredRepo.Hooks[j] = filteredHook
+		}
+		filtered.Repos[i] = filteredRepo
+	}
+	return filtered
+}
+
 type poetryLock struct {
 	Metadata struct {
 		LockVersion string `toml:"lock-version"`
@@ -98,9 +431,49 @@ type poetryLock struct {
 	}
 }
 
+func (lockfile poetryLock) LockedVersion(name string) (version string, ok bool) {
+	name = normalizeName(name)
+	for _, pkg := range lockfile.Package {
+		if normalizeName(pkg.Name) == name {
+			return pkg.Version, true
+		}
+	}
+	return "", false
+}
+
 // Read and parse poetry.lock.
 func loadPoetryLock(fsys fs.FS) (lockfile poetryLock, err error) {
-	data, err := fs.ReadFile(fsys, "poetry.lock")
+	return loadPoetryLockFile(fsys, "poetry.lock")
+}
+
+func loadPoetryLockFile(fsys fs.FS, path string) (lockfile poetryLock, err error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return
+	}
+	err = toml.Unmarshal(data, &lockfile)
+	return
+}
+
+type pdmLock struct {
+	Package []struct {
+		Name    string
+		Version string
+	}
+}
+
+func (lockfile pdmLock) LockedVersion(name string) (version string, ok bool) {
+	name = normalizeName(name)
+	for _, pkg := range lockfile.Package {
+		if normalizeName(pkg.Name) == name {
+			return pkg.Version, true
+		}
+	}
+	return "", false
+}
+
+func loadPdmLockFile(fsys fs.FS, path string) (lockfile pdmLock, err error) {
+	data, err := fs.ReadFile(fsys, path)
 	if err != nil {
 		return
 	}
@@ -108,17 +481,116 @@ func loadPoetryLock(fsys fs.FS) (lockfile poetryLock, err error) {
 	return
 }
 
-// Check the versions of additional_dependencies in a pre-commit config against those in a poetry.lock.
+type uvLock struct {
+	Package []struct {
+		Name    string
+		Version string
+	}
+}
+
+func (lockfile uvLock) LockedVersion(name string) (version string, ok bool) {
+	name = normalizeName(name)
+	for _, pkg := range lockfile.Package {
+		if normalizeName(pkg.Name) == name {
+			return pkg.Version, true
+		}
+	}
+	return "", false
+}
+
+func loadUvLockFile(fsys fs.FS, path string) (lockfile uvLock, err error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return
+	}
+	err = toml.Unmarshal(data, &lockfile)
+	return
+}
+
+type pipfileLock struct {
+	Default map[string]struct {
+		Version string `json:"version"`
+	} `json:"default"`
+	Develop map[string]struct {
+		Version string `json:"version"`
+	} `json:"develop"`
+}
+
+func (lockfile pipfileLock) LockedVersion(name string) (version string, ok bool) {
+	name = normalizeName(name)
+	for _, section := range []map[string]struct {
+		Version string `json:"version"`
+	}{lockfile.Default, lockfile.Develop} {
+		for pkgName, pkg := range section {
+			if normalizeName(pkgName) != name {
+				continue
+			}
+			// VCS/path/editable pins (e.g. {"git": "...", "ref": "..."}) have no "version" key, so
+			// treat them as not found rather than returning an empty version that can't be parsed.
+			if pkg.Version == "" {
+				continue
+			}
+			return strings.TrimPrefix(pkg.Version, "=="), true
+		}
+	}
+	return "", false
+}
+
+func loadPipfileLockFile(fsys fs.FS, path string) (lockfile pipfileLock, err error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &lockfile)
+	return
+}
+
+// requirementsTxt is a LockSource backed by a fully-pinned requirements.txt: lines of the form
+// "name==version", with blank lines, "#" comments and "-"-prefixed options (e.g. "-r base.txt",
+// "--index-url ...") ignored. Any line that isn't an exact pin is skipped, since it doesn't lock
+// a specific version.
+type requirementsTxt map[string]string
+
+func (lockfile requirementsTxt) LockedVersion(name string) (version string, ok bool) {
+	version, ok = lockfile[normalizeName(name)]
+	return
+}
+
+func loadRequirementsTxtFile(fsys fs.FS, path string) (lockfile requirementsTxt, err error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return
+	}
+	lockfile = make(requirementsTxt)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = strings.TrimSpace(line[:idx])
+		}
+		name, version, ok := strings.Cut(line, "==")
+		if !ok {
+			continue
+		}
+		lockfile[normalizeName(strings.TrimSpace(name))] = strings.TrimSpace(version)
+	}
+	return
+}
+
+// Check the versions of additional_dependencies in a pre-commit config against those in a lockfile.
 // Only hooks with the specified `hookIds` will be checked.
 //
 // For each dependency in additional_dependencies, the following checks are made:
 // - the dependency specifier must be in the format "package-name==exact.version"
 // - the package name in the dependency specifier must be in the lockfile
 // - the version in the dependency specifier must match the lockfile
-func checkVersions(config preCommitConfig, lockfile poetryLock, hookIds []string) (problems []string) {
+func checkVersions(config preCommitConfig, lockfile LockSource, hookIds []string) (problems []string) {
+	normalizedHookIds := normalizeNames(hookIds)
 	for _, repo := range config.Repos {
 		for _, hook := range repo.Hooks {
-			if slices.Contains(hookIds, hook.Id) {
+			if slices.Contains(normalizedHookIds, normalizeName(hook.Id)) {
 				for _, depspec := range hook.AdditionalDependencies {
 					if problem := checkVersion(depspec, lockfile); problem != "" {
 						problems = append(problems, fmt.Sprintf("%v: %v", depspec, problem))
@@ -139,9 +611,26 @@ var versionOnePat = `\s*(?:<|<=|!=|==|>=|>|~=|===)\s*(?:[a-zA-Z0-9]|[-_.*+!])+\s
 var versionManyPat = fmt.Sprint(versionOnePat, `(?:\s*,`, versionOnePat, `)*`)
 var versionspecPat = fmt.Sprint(`\(`, versionManyPat, `\)|`, versionManyPat)
 
-var pat = regexp.MustCompile(fmt.Sprint(`^(`, namePat, `)\s*(?:`, extrasPat, `)?\s*(`, versionspecPat, `)?$`))
+var pat = regexp.MustCompile(fmt.Sprint(`^(`, namePat, `)\s*(`, extrasPat, `)?\s*(`, versionspecPat, `)?$`))
+
+var normalizeNamePat = regexp.MustCompile(`[-_.]+`)
+
+// normalizeName normalizes a PyPI package name per PEP 503, so that e.g. "FLAKE8-DocStrings" and
+// "flake8_typing.imports" compare equal to "flake8-docstrings" and "flake8-typing-imports".
+func normalizeName(s string) string {
+	return strings.ToLower(normalizeNamePat.ReplaceAllString(s, "-"))
+}
+
+// normalizeNames normalizes every element of ss.
+func normalizeNames(ss []string) []string {
+	normalized := make([]string, len(ss))
+	for i, s := range ss {
+		normalized[i] = normalizeName(s)
+	}
+	return normalized
+}
 
-func checkVersion(depspec string, lockfile poetryLock) (problem string) {
+func checkVersion(depspec string, lockfile LockSource) (problem string) {
 	// Strictly speaking, the grammar of entries in additional_dependencies is defined by PEP 508; PEP 440 specifies
 	// only the version constraints. However, in practice, it's easy enough to parse a minimal subset of PEP 508
 	// specifiers given an existing PEP 440 parser. To simplify things, we reject specifiers with environment markers
@@ -159,12 +648,7 @@ func checkVersion(depspec string, lockfile poetryLock) (problem string) {
 	if matches == nil {
 		return "invalid dependency specification"
 	}
-	lockedPackages := make(map[string]string)
-	for _, pkg := range lockfile.Package {
-		// TODO: normalise package names everywhere
-		lockedPackages[pkg.Name] = pkg.Version
-	}
-	name, rawVersion := matches[1], matches[2]
+	name, rawVersion := matches[1], matches[3]
 	if rawVersion == "" {
 		return "empty version spec not permitted"
 	}
@@ -172,13 +656,13 @@ func checkVersion(depspec string, lockfile poetryLock) (problem string) {
 	if err != nil {
 		return "invalid version specification"
 	}
-	rawLockedVersion, ok := lockedPackages[name]
+	rawLockedVersion, ok := lockfile.LockedVersion(name)
 	if !ok {
-		return "not found in poetry.lock"
+		return "not found in lockfile"
 	}
 	lockedVersion, err := version.Parse(rawLockedVersion)
 	if err != nil {
-		panic(fmt.Sprintf("failed to parse version from poetry.lock: %q %q", name, rawLockedVersion))
+		panic(fmt.Sprintf("failed to parse locked version: %q %q", name, rawLockedVersion))
 	}
 	if !versionSpec.Check(lockedVersion) {
 		return fmt.Sprintf("version mismatch (expected: %v)", lockedVersion)
@@ -194,3 +678,463 @@ func checkVersion(depspec string, lockfile poetryLock) (problem string) {
 	}
 	return ""
 }
+
+// fixVersions rewrites, in place, the additional_dependencies scalar nodes of every hook in
+// hookIds to pin the version locked in the lockfile, preserving extras and leaving everything
+// else in the document (including comments and formatting) untouched. Dependencies whose name is
+// in ignore (e.g. meta-plugins whose versions intentionally float) are left alone, matching the
+// same ignore list checkVersions/auditVersions/checkPyprojectConstraints apply via filterIgnored.
+// It reports whether any node was changed.
+func fixVersions(root *yaml.Node, lockfile LockSource, hookIds []string, ignore []string) (fixed bool) {
+	normalizedHookIds := normalizeNames(hookIds)
+	normalizedIgnore := normalizeNames(ignore)
+	doc := root
+	if doc.Kind == yaml.DocumentNode {
+		doc = doc.Content[0]
+	}
+	repos := mappingValue(doc, "repos")
+	if repos == nil {
+		return false
+	}
+	for _, repoNode := range repos.Content {
+		hooks := mappingValue(repoNode, "hooks")
+		if hooks == nil {
+			continue
+		}
+		for _, hookNode := range hooks.Content {
+			idNode := mappingValue(hookNode, "id")
+			if idNode == nil || !slices.Contains(normalizedHookIds, normalizeName(idNode.Value)) {
+				continue
+			}
+			deps := mappingValue(hookNode, "additional_dependencies")
+			if deps == nil {
+				continue
+			}
+			for _, depNode := range deps.Content {
+				if matches := pat.FindStringSubmatch(strings.TrimSpace(depNode.Value)); matches != nil &&
+					slices.Contains(normalizedIgnore, normalizeName(matches[1])) {
+					continue
+				}
+				if fixedValue, ok := fixVersion(depNode.Value, lockfile); ok && fixedValue != depNode.Value {
+					depNode.Value = fixedValue
+					depNode.Tag = "!!str"
+					fixed = true
+				}
+			}
+		}
+	}
+	return fixed
+}
+
+// mappingValue returns the value node for key in a YAML mapping node, or nil if it isn't present.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// fixVersion computes the canonical "name[extras]==version" form of depspec, pinned to whatever
+// version is locked in the lockfile. It returns ok=false when the dependency can't be resolved
+// unambiguously, e.g. because it's a URL, has an environment marker, doesn't parse, or isn't in
+// the lockfile at all.
+func fixVersion(depspec string, lockfile LockSource) (fixed string, ok bool) {
+	depspec = strings.TrimSpace(depspec)
+	if strings.IndexAny(depspec, ";@") != -1 {
+		return "", false
+	}
+	matches := pat.FindStringSubmatch(depspec)
+	if matches == nil {
+		return "", false
+	}
+	name, extras := matches[1], matches[2]
+	lockedVersion, ok := lockfile.LockedVersion(name)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s%s==%s", name, extras, lockedVersion), true
+}
+
+// osvPackage identifies a pinned PyPI package for an OSV.dev query.
+type osvPackage struct {
+	Name    string
+	Version string
+}
+
+type osvVuln struct {
+	ID string `json:"id"`
+}
+
+type osvQuery struct {
+	Package struct {
+		Name      string `json:"name"`
+		Ecosystem string `json:"ecosystem"`
+	} `json:"package"`
+	Version string `json:"version"`
+}
+
+type osvQueryBatchRequest struct {
+	Queries []osvQuery `json:"queries"`
+}
+
+type osvQueryResult struct {
+	Vulns []osvVuln `json:"vulns"`
+}
+
+type osvQueryBatchResponse struct {
+	Results []osvQueryResult `json:"results"`
+}
+
+const osvQueryBatchURL = "https://api.osv.dev/v1/querybatch"
+
+// auditVersions checks every pinned dependency of the checked hooks against the OSV.dev
+// vulnerability database, returning a problem string for each advisory found. Only hooks with
+// the specified hookIds are considered, and only dependencies pinned to an exact version (i.e.
+// those that already passed checkVersions) are queryable. Results are cached on disk so that
+// repeated (e.g. CI) runs don't re-query the network; --offline restricts lookups to the cache,
+// silently skipping any package that hasn't been queried before.
+func auditVersions(config preCommitConfig, hookIds []string, offline bool) (problems []string, err error) {
+	targets := auditTargets(config, hookIds)
+	cacheDir, err := osvCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	vulns := make(map[osvPackage][]osvVuln, len(targets))
+	var toQuery []osvPackage
+	for _, target := range targets {
+		cachedVulns, ok, err := readOSVCache(cacheDir, target)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			vulns[target] = cachedVulns
+		} else if !offline {
+			toQuery = append(toQuery, target)
+		}
+	}
+	if len(toQuery) > 0 {
+		results, err := queryOSV(toQuery)
+		if err != nil {
+			return nil, err
+		}
+		for i, target := range toQuery {
+			vulns[target] = results[i].Vulns
+			if err := writeOSVCache(cacheDir, target, results[i].Vulns); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, target := range targets {
+		for _, vuln := range vulns[target] {
+			problems = append(problems, fmt.Sprintf("%v==%v: %v", target.Name, target.Version, vuln.ID))
+		}
+	}
+	return
+}
+
+// auditTargets extracts the set of exactly-pinned (name, version) pairs from additional_dependencies
+// in the specified hooks, deduplicated.
+func auditTargets(config preCommitConfig, hookIds []string) (targets []osvPackage) {
+	normalizedHookIds := normalizeNames(hookIds)
+	seen := make(map[osvPackage]bool)
+	for _, repo := range config.Repos {
+		for _, hook := range repo.Hooks {
+			if !slices.Contains(normalizedHookIds, normalizeName(hook.Id)) {
+				continue
+			}
+			for _, depspec := range hook.AdditionalDependencies {
+				matches := pat.FindStringSubmatch(strings.TrimSpace(depspec))
+				if matches == nil {
+					continue
+				}
+				pinnedVersion, exact := strings.CutPrefix(strings.TrimSpace(matches[3]), "==")
+				if !exact || strings.ContainsAny(pinnedVersion, "=,*") {
+					continue
+				}
+				target := osvPackage{Name: normalizeName(matches[1]), Version: strings.TrimSpace(pinnedVersion)}
+				if !seen[target] {
+					seen[target] = true
+					targets = append(targets, target)
+				}
+			}
+		}
+	}
+	return
+}
+
+// osvCacheDir returns (creating it if necessary) the directory that OSV.dev query results are
+// cached under, honouring $XDG_CACHE_HOME.
+func osvCacheDir() (string, error) {
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".cache")
+	}
+	dir := filepath.Join(base, "sync-versions-poetry")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func osvCachePath(dir string, pkg osvPackage) string {
+	return filepath.Join(dir, fmt.Sprintf("%s@%s.json", pkg.Name, pkg.Version))
+}
+
+func readOSVCache(dir string, pkg osvPackage) (vulns []osvVuln, ok bool, err error) {
+	data, err := os.ReadFile(osvCachePath(dir, pkg))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(data, &vulns); err != nil {
+		return nil, false, err
+	}
+	return vulns, true, nil
+}
+
+func writeOSVCache(dir string, pkg osvPackage, vulns []osvVuln) error {
+	data, err := json.Marshal(vulns)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(osvCachePath(dir, pkg), data, 0666)
+}
+
+// queryOSV queries the OSV.dev batch API for every package in pkgs, returning one result per
+// package in the same order.
+func queryOSV(pkgs []osvPackage) ([]osvQueryResult, error) {
+	var body osvQueryBatchRequest
+	for _, pkg := range pkgs {
+		var query osvQuery
+		query.Package.Name = pkg.Name
+		query.Package.Ecosystem = "PyPI"
+		query.Version = pkg.Version
+		body.Queries = append(body.Queries, query)
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Post(osvQueryBatchURL, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OSV.dev query failed: %v", resp.Status)
+	}
+	var result osvQueryBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Results, nil
+}
+
+// loadPyprojectConstraints reads the version constraints declared for each dependency in
+// pyproject.toml, covering both Poetry's legacy [tool.poetry.dependencies] table (whose values may
+// be a bare version string or an inline table with a "version" key, and which may declare a
+// "python" entry that isn't a package) and PEP 621's [project.dependencies] and
+// [project.optional-dependencies], which are PEP 508 specifier strings. The result maps normalized
+// package name to a PEP 440 specifier set usable with version.NewSpecifiers.
+func loadPyprojectConstraints(fsys fs.FS, path string) (constraints map[string]string, err error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := toml.LoadBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	constraints = make(map[string]string)
+	if poetryDeps, ok := tree.Get("tool.poetry.dependencies").(*toml.Tree); ok {
+		for _, name := range poetryDeps.Keys() {
+			if name == "python" {
+				continue
+			}
+			var raw string
+			switch value := poetryDeps.Get(name).(type) {
+			case string:
+				raw = value
+			case *toml.Tree:
+				version, ok := value.Get("version").(string)
+				if !ok {
+					continue
+				}
+				raw = version
+			default:
+				continue
+			}
+			spec, err := poetryConstraintToPEP440(raw)
+			if err != nil {
+				continue
+			}
+			constraints[normalizeName(name)] = spec
+		}
+	}
+	addPep508 := func(depspec string) {
+		matches := pat.FindStringSubmatch(strings.TrimSpace(depspec))
+		if matches == nil || matches[3] == "" {
+			return
+		}
+		constraints[normalizeName(matches[1])] = matches[3]
+	}
+	if deps, ok := tree.Get("project.dependencies").([]interface{}); ok {
+		for _, dep := range deps {
+			if depspec, ok := dep.(string); ok {
+				addPep508(depspec)
+			}
+		}
+	}
+	if optional, ok := tree.Get("project.optional-dependencies").(*toml.Tree); ok {
+		for _, extra := range optional.Keys() {
+			deps, ok := optional.Get(extra).([]interface{})
+			if !ok {
+				continue
+			}
+			for _, dep := range deps {
+				if depspec, ok := dep.(string); ok {
+					addPep508(depspec)
+				}
+			}
+		}
+	}
+	return constraints, nil
+}
+
+// poetryConstraintToPEP440 translates a Poetry-style version constraint into an equivalent PEP 440
+// specifier set that version.NewSpecifiers can parse: Poetry's "^version" and "~version" range
+// shorthand, and a bare version (which Poetry treats the same as "^version"), are rewritten as an
+// explicit ">=x,<y" range. A constraint that already looks like PEP 440 (it uses "~=" or contains
+// one of the PEP 440 comparison operators) is passed through unchanged.
+func poetryConstraintToPEP440(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case raw == "":
+		return "", fmt.Errorf("empty constraint")
+	case strings.HasPrefix(raw, "^"):
+		return caretRange(strings.TrimPrefix(raw, "^"))
+	case strings.HasPrefix(raw, "~="), strings.ContainsAny(raw, "<>=!"):
+		return raw, nil
+	case strings.HasPrefix(raw, "~"):
+		return tildeRange(strings.TrimPrefix(raw, "~"))
+	default:
+		return caretRange(raw)
+	}
+}
+
+// caretRange implements Poetry's "^version" operator: the version may change freely below the
+// leftmost non-zero release segment, which may not change.
+func caretRange(raw string) (string, error) {
+	segments, err := releaseSegments(raw)
+	if err != nil {
+		return "", err
+	}
+	upper := append([]int(nil), segments...)
+	bumped := false
+	for i, segment := range upper {
+		if segment != 0 {
+			upper[i] = segment + 1
+			for j := i + 1; j < len(upper); j++ {
+				upper[j] = 0
+			}
+			bumped = true
+			break
+		}
+	}
+	if !bumped {
+		upper[len(upper)-1]++
+	}
+	return fmt.Sprintf(">=%s,<%s", joinSegments(segments), joinSegments(upper)), nil
+}
+
+// tildeRange implements Poetry's "~version" operator: patch-level changes are allowed, pinning the
+// major and minor release segments (or just the major, if no minor segment was given).
+func tildeRange(raw string) (string, error) {
+	segments, err := releaseSegments(raw)
+	if err != nil {
+		return "", err
+	}
+	upper := append([]int(nil), segments...)
+	bumpAt := 0
+	if len(upper) > 1 {
+		bumpAt = 1
+	}
+	upper[bumpAt]++
+	for i := bumpAt + 1; i < len(upper); i++ {
+		upper[i] = 0
+	}
+	return fmt.Sprintf(">=%s,<%s", joinSegments(segments), joinSegments(upper)), nil
+}
+
+// releaseSegments parses a dotted release version like "1.2.3" into its integer segments.
+func releaseSegments(raw string) ([]int, error) {
+	parts := strings.Split(raw, ".")
+	segments := make([]int, len(parts))
+	for i, part := range parts {
+		segment, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version segment %q in %q", part, raw)
+		}
+		segments[i] = segment
+	}
+	return segments, nil
+}
+
+// joinSegments formats release segments back into a dotted version string.
+func joinSegments(segments []int) string {
+	parts := make([]string, len(segments))
+	for i, segment := range segments {
+		parts[i] = strconv.Itoa(segment)
+	}
+	return strings.Join(parts, ".")
+}
+
+// checkPyprojectConstraints cross-checks the additional_dependencies pins of the specified hooks
+// against the version constraints declared in pyproject.toml (constraints, keyed by normalized
+// package name), reporting any exact pin that doesn't satisfy its declared constraint. This is a
+// distinct problem class from checkVersions: a pin can match the lockfile exactly and still
+// violate what pyproject.toml actually declares, if the two have drifted apart.
+func checkPyprojectConstraints(config preCommitConfig, hookIds []string, constraints map[string]string) (problems []string) {
+	normalizedHookIds := normalizeNames(hookIds)
+	for _, repo := range config.Repos {
+		for _, hook := range repo.Hooks {
+			if !slices.Contains(normalizedHookIds, normalizeName(hook.Id)) {
+				continue
+			}
+			for _, depspec := range hook.AdditionalDependencies {
+				matches := pat.FindStringSubmatch(strings.TrimSpace(depspec))
+				if matches == nil || !strings.Contains(matches[3], "==") {
+					continue
+				}
+				rawConstraint, ok := constraints[normalizeName(matches[1])]
+				if !ok {
+					continue
+				}
+				pinnedVersion := strings.TrimPrefix(strings.TrimSpace(matches[3]), "==")
+				pinned, err := version.Parse(pinnedVersion)
+				if err != nil {
+					continue
+				}
+				spec, err := version.NewSpecifiers(rawConstraint)
+				if err != nil {
+					continue
+				}
+				if !spec.Check(pinned) {
+					problems = append(problems, fmt.Sprintf("%v: pinned %v violates pyproject constraint %v", depspec, pinnedVersion, rawConstraint))
+				}
+			}
+		}
+	}
+	return
+}
@@ -20,10 +20,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 // When a .pre-commit-config.yaml and poetry.lock are present, the root command should succeed.
@@ -58,6 +62,195 @@ func TestExecuteMissingConfig(t *testing.T) {
 	t.Fatal("did not panic")
 }
 
+// TestHelperProcess isn't a real test: it's re-exec'd as a subprocess by runRootCmd below, so
+// that the end-to-end tests can observe rootCmd's real exit code (including the os.Exit(1) paths)
+// without taking down the actual test binary.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// runRootCmd runs rootCmd in a subprocess with args, in dir, returning its exit code and combined
+// output. Running out-of-process lets these tests observe os.Exit paths (e.g. --fix/--dry-run
+// reporting that a change was made) without killing the real test binary.
+func runRootCmd(t *testing.T, dir string, env []string, args ...string) (exitCode int, output string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=TestHelperProcess", "--"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "GO_WANT_HELPER_PROCESS=1"), env...)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return 0, string(out)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), string(out)
+	}
+	t.Fatal(err)
+	return 0, ""
+}
+
+// End-to-end tests driving rootCmd through its actual Cobra flags, rather than calling the
+// underlying helper functions directly. These exercise the exit-code convention (0 = nothing to
+// report, 1 = problems found or, for --fix/--dry-run, a change was made or would be made) and the
+// .sync-versions-poetry.toml-driven resolveChecks fan-out alongside it.
+func TestExecuteEndToEnd(t *testing.T) {
+	poetryLockContents := `
+[[package]]
+name = "flake8-docstrings"
+version = "1.7.0"
+`
+	stalePreCommitConfig := `repos:
+  - hooks:
+      - id: flake8
+        additional_dependencies:
+          - flake8-docstrings==1.6.0
+`
+	fixedPreCommitConfig := `repos:
+  - hooks:
+      - id: flake8
+        additional_dependencies:
+          - flake8-docstrings==1.7.0
+`
+
+	t.Run("--fix rewrites a stale pin and exits 1", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, ".pre-commit-config.yaml", stalePreCommitConfig)
+		writeFile(t, dir, "poetry.lock", poetryLockContents)
+		code, _ := runRootCmd(t, dir, nil, "--fix", "flake8")
+		if code != 1 {
+			t.Errorf("got exit code %d, wanted 1", code)
+		}
+		if got := readFile(t, dir, ".pre-commit-config.yaml"); got != fixedPreCommitConfig {
+			t.Errorf("file not fixed, got:\n%s", got)
+		}
+	})
+
+	t.Run("--fix is a no-op and exits 0 when already correct", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, ".pre-commit-config.yaml", fixedPreCommitConfig)
+		writeFile(t, dir, "poetry.lock", poetryLockContents)
+		code, _ := runRootCmd(t, dir, nil, "--fix", "flake8")
+		if code != 0 {
+			t.Errorf("got exit code %d, wanted 0", code)
+		}
+	})
+
+	t.Run("--dry-run prints a diff, leaves the file untouched, and exits 1", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, ".pre-commit-config.yaml", stalePreCommitConfig)
+		writeFile(t, dir, "poetry.lock", poetryLockContents)
+		code, output := runRootCmd(t, dir, nil, "--dry-run", "flake8")
+		if code != 1 {
+			t.Errorf("got exit code %d, wanted 1", code)
+		}
+		if !strings.Contains(output, "flake8-docstrings==1.7.0") {
+			t.Errorf("diff missing fixed version, got:\n%s", output)
+		}
+		if got := readFile(t, dir, ".pre-commit-config.yaml"); got != stalePreCommitConfig {
+			t.Errorf("--dry-run should not write the file, got:\n%s", got)
+		}
+	})
+
+	t.Run("--audit --offline with no cached vulnerabilities exits 0", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, ".pre-commit-config.yaml", fixedPreCommitConfig)
+		writeFile(t, dir, "poetry.lock", poetryLockContents)
+		code, _ := runRootCmd(t, dir, []string{"XDG_CACHE_HOME=" + t.TempDir()}, "--audit", "--offline", "flake8")
+		if code != 0 {
+			t.Errorf("got exit code %d, wanted 0", code)
+		}
+	})
+
+	t.Run("--lockfile selects an explicitly named lockfile", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, ".pre-commit-config.yaml", fixedPreCommitConfig)
+		writeFile(t, dir, "locked-requirements.txt", "flake8-docstrings==1.7.0\n")
+		code, _ := runRootCmd(t, dir, nil, "--lockfile", "locked-requirements.txt", "flake8")
+		if code != 0 {
+			t.Errorf("got exit code %d, wanted 0", code)
+		}
+	})
+
+	t.Run("--pyproject reports a pin that violates the declared constraint", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, ".pre-commit-config.yaml", fixedPreCommitConfig)
+		writeFile(t, dir, "poetry.lock", poetryLockContents)
+		writeFile(t, dir, "pyproject.toml", `[project]
+dependencies = ["flake8-docstrings>=2.0"]
+`)
+		code, output := runRootCmd(t, dir, nil, "--pyproject", "pyproject.toml", "flake8")
+		if code != 1 {
+			t.Errorf("got exit code %d, wanted 1", code)
+		}
+		if !strings.Contains(output, "pyproject constraint") {
+			t.Errorf("missing pyproject constraint problem, got:\n%s", output)
+		}
+	})
+
+	t.Run(".sync-versions-poetry.toml fans out checks and still applies ignore", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, ".pre-commit-config.yaml", `repos:
+  - hooks:
+      - id: flake8
+        additional_dependencies:
+          - flake8-docstrings==1.6.0
+      - id: mypy
+        additional_dependencies:
+          - some-floating-plugin==0.1.0
+`)
+		writeFile(t, dir, "poetry.lock", poetryLockContents)
+		writeFile(t, dir, ".sync-versions-poetry.toml", `[[check]]
+hook_id = "flake8"
+lockfile = "poetry.lock"
+
+[[check]]
+hook_id = "mypy"
+lockfile = "poetry.lock"
+ignore = ["some-floating-plugin"]
+`)
+		code, output := runRootCmd(t, dir, nil)
+		if code != 1 {
+			t.Errorf("got exit code %d, wanted 1", code)
+		}
+		if !strings.Contains(output, "flake8-docstrings==1.6.0") {
+			t.Errorf("missing flake8 problem, got:\n%s", output)
+		}
+		if strings.Contains(output, "some-floating-plugin") {
+			t.Errorf("ignored dependency should not be reported, got:\n%s", output)
+		}
+	})
+}
+
+func writeFile(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	if err := os.WriteFile(dir+"/"+name, []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(dir + "/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
 // When run in a directory with a .pre-commit-config.yaml,
 // readPreCommitFile() should succeed.
 func TestReadPreCommitFile(t *testing.T) {
@@ -69,7 +262,7 @@ func TestReadPreCommitFile(t *testing.T) {
 
 // When passed a valid pre-commit file, loadPreCommitConfig() should succeed.
 func TestLoadPreCommitConfig(t *testing.T) {
-	config, err := loadPreCommitConfig([]byte(`
+	root, err := loadPreCommitConfig([]byte(`
 repos:
 - hooks:
   - id: foo
@@ -78,6 +271,10 @@ repos:
 	if err != nil {
 		t.Error(err)
 	}
+	var config preCommitConfig
+	if err := root.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
 	var id = config.Repos[0].Hooks[0].Id
 	if id != "foo" {
 		t.Error("wrong name:", id)
@@ -99,6 +296,63 @@ func TestLoadPoetryLock(t *testing.T) {
 	}
 }
 
+// Each supported lockfile format should report the locked version of a known package, and report
+// not-found for an unknown one.
+func TestLockSources(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pdm.lock": &fstest.MapFile{Data: []byte(`
+[[package]]
+name = "virtualenv"
+version = "20.25.0"
+`)},
+		"uv.lock": &fstest.MapFile{Data: []byte(`
+[[package]]
+name = "virtualenv"
+version = "20.25.0"
+`)},
+		"Pipfile.lock": &fstest.MapFile{Data: []byte(`{
+			"default": {"virtualenv": {"version": "==20.25.0"}, "some-vcs-dep": {"git": "https://example.com/repo.git", "ref": "main"}},
+			"develop": {"flake8": {"version": "==7.0.0"}}
+		}`)},
+		"requirements.txt": &fstest.MapFile{Data: []byte(`
+# a comment
+-r base.txt
+--index-url https://example.com
+virtualenv==20.25.0
+underspecified>=1
+`)},
+	}
+	tests := []struct {
+		path string
+		name string
+		want string
+	}{
+		{"pdm.lock", "virtualenv", "20.25.0"},
+		{"pdm.lock", "does-not-exist", ""},
+		{"uv.lock", "virtualenv", "20.25.0"},
+		{"Pipfile.lock", "virtualenv", "20.25.0"},
+		{"Pipfile.lock", "flake8", "7.0.0"},
+		{"Pipfile.lock", "some-vcs-dep", ""},
+		{"requirements.txt", "virtualenv", "20.25.0"},
+		{"requirements.txt", "underspecified", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.path+"/"+test.name, func(t *testing.T) {
+			source, err := loadLockSource(fsys, test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := source.LockedVersion(test.name)
+			if got != test.want || ok != (test.want != "") {
+				t.Errorf("got (%q, %v) wanted (%q, %v)", got, ok, test.want, test.want != "")
+			}
+		})
+	}
+	if _, err := loadLockSource(fsys, "Cargo.lock"); err == nil {
+		t.Error("expected an error for an unrecognized lockfile format")
+	}
+}
+
 // When passed no hooks, or a hook with no additional_dependencies, checkVersions() should succeed.
 func TestCheckVersionsSimple(t *testing.T) {
 	tests := []struct {
@@ -111,10 +365,14 @@ func TestCheckVersionsSimple(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	config, err := loadPreCommitConfig(file)
+	root, err := loadPreCommitConfig(file)
 	if err != nil {
 		t.Fatal(err)
 	}
+	var config preCommitConfig
+	if err := root.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
 	for _, test := range tests {
 		t.Run(fmt.Sprintf("%v", test.hooks), func(t *testing.T) {
 			problems := checkVersions(config, poetryLock{}, test.hooks)
@@ -131,10 +389,14 @@ func TestCheckVersionsFailing(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	config, err := loadPreCommitConfig(file)
+	root, err := loadPreCommitConfig(file)
 	if err != nil {
 		t.Fatal(err)
 	}
+	var config preCommitConfig
+	if err := root.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
 	lockfile, err := loadPoetryLock(os.DirFS("testdata"))
 	if err != nil {
 		t.Fatal(err)
@@ -145,6 +407,50 @@ func TestCheckVersionsFailing(t *testing.T) {
 	}
 }
 
+// auditTargets() should extract the unique, exactly-pinned (name, version) pairs from the
+// checked hooks, ignoring other hooks and unpinned/unparseable dependencies.
+func TestAuditTargets(t *testing.T) {
+	root, err := loadPreCommitConfig([]byte(`repos:
+- hooks:
+  - id: flake8
+    additional_dependencies: [virtualenv==20.25.0, virtualenv==20.25.0, click>=8, "not a valid spec !!"]
+  - id: other
+    additional_dependencies: [tox==4.0.0]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config preCommitConfig
+	if err := root.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	got := auditTargets(config, []string{"flake8"})
+	want := []osvPackage{{Name: "virtualenv", Version: "20.25.0"}}
+	if !slices.Equal(got, want) {
+		t.Error("incorrect targets", got)
+	}
+}
+
+// The OSV.dev result cache should round-trip through disk.
+func TestOSVCache(t *testing.T) {
+	dir := t.TempDir()
+	pkg := osvPackage{Name: "virtualenv", Version: "20.25.0"}
+	if _, ok, err := readOSVCache(dir, pkg); err != nil || ok {
+		t.Fatalf("expected a cache miss, got ok=%v err=%v", ok, err)
+	}
+	want := []osvVuln{{ID: "OSV-2024-1"}}
+	if err := writeOSVCache(dir, pkg, want); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := readOSVCache(dir, pkg)
+	if err != nil || !ok {
+		t.Fatalf("expected a cache hit, got ok=%v err=%v", ok, err)
+	}
+	if !slices.Equal(got, want) {
+		t.Error("incorrect cached vulns", got)
+	}
+}
+
 // When passed a dependency, checkVersion() should return a problem when appropriate.
 func TestCheckVersion(t *testing.T) {
 	tests := []struct {
@@ -171,7 +477,7 @@ func TestCheckVersion(t *testing.T) {
 		{"virtualenv==20.25.0 ; python_version < \"3.14\"", "environment markers not permitted"},
 		{"virtualenv @ https://example.com#sha1=da39a3ee5e6b4b0d3255bfef95601890afd80709 ; python_version < \"3.14\"", "URLs not permitted"},
 		// Packages not in poetry.lock are not allowed
-		{"does-not-exist==1.2.3", "not found in poetry.lock"},
+		{"does-not-exist==1.2.3", "not found in lockfile"},
 		// Invalid dependency specifiers are not allowed
 		{"this is nonsense", "invalid dependency specification"},
 		{"different-nonsense==1..100", "invalid version specification"},
@@ -193,6 +499,239 @@ func TestCheckVersion(t *testing.T) {
 	}
 }
 
+// When passed a dependency, fixVersion() should compute its canonical pinned form.
+func TestFixVersion(t *testing.T) {
+	lockfile := poetryLock{Package: []struct {
+		Name    string
+		Version string
+	}{
+		{Name: "virtualenv", Version: "20.25.0"},
+	}}
+	tests := []struct {
+		depspec string
+		fixed   string
+		ok      bool
+	}{
+		{"virtualenv==20.24.0", "virtualenv==20.25.0", true},
+		{"virtualenv==20.25.0", "virtualenv==20.25.0", true},
+		{"virtualenv[foo,bar]>=20,<21", "virtualenv[foo,bar]==20.25.0", true},
+		{"does-not-exist==1.2.3", "", false},
+		{"virtualenv @ http://example.com#sha1=da39a3ee5e6b4b0d3255bfef95601890afd80709", "", false},
+		{"this is nonsense", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.depspec, func(t *testing.T) {
+			fixed, ok := fixVersion(test.depspec, lockfile)
+			if fixed != test.fixed || ok != test.ok {
+				t.Errorf("got (%q, %v) wanted (%q, %v)", fixed, ok, test.fixed, test.ok)
+			}
+		})
+	}
+}
+
+// fixVersions() should rewrite only the additional_dependencies of the requested hooks, leaving
+// everything else (including unrelated hooks and formatting) untouched.
+func TestFixVersions(t *testing.T) {
+	lockfile := poetryLock{Package: []struct {
+		Name    string
+		Version string
+	}{
+		{Name: "virtualenv", Version: "20.25.0"},
+	}}
+	root, err := loadPreCommitConfig([]byte(`repos:
+- hooks:
+  - id: flake8
+    additional_dependencies: [virtualenv==20.24.0]
+  - id: other
+    additional_dependencies: [virtualenv==20.24.0]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fixVersions(root, lockfile, []string{"flake8"}, nil) {
+		t.Fatal("expected a fix to be made")
+	}
+	var config preCommitConfig
+	if err := root.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Repos[0].Hooks[0].AdditionalDependencies[0]; got != "virtualenv==20.25.0" {
+		t.Error("flake8 dependency not fixed:", got)
+	}
+	if got := config.Repos[0].Hooks[1].AdditionalDependencies[0]; got != "virtualenv==20.24.0" {
+		t.Error("unrelated hook should be untouched:", got)
+	}
+	if fixVersions(root, lockfile, []string{"flake8"}, nil) {
+		t.Error("expected no further changes for an already-fixed dependency")
+	}
+}
+
+// fixVersions() should leave dependencies named in ignore untouched, the same as filterIgnored()
+// does for checkVersions/auditVersions/checkPyprojectConstraints.
+func TestFixVersionsIgnore(t *testing.T) {
+	lockfile := poetryLock{Package: []struct {
+		Name    string
+		Version string
+	}{
+		{Name: "virtualenv", Version: "20.25.0"},
+	}}
+	root, err := loadPreCommitConfig([]byte(`repos:
+- hooks:
+  - id: flake8
+    additional_dependencies: [virtualenv==20.24.0]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixVersions(root, lockfile, []string{"flake8"}, []string{"VirtualEnv"}) {
+		t.Error("expected no fix for an ignored dependency")
+	}
+	var config preCommitConfig
+	if err := root.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Repos[0].Hooks[0].AdditionalDependencies[0]; got != "virtualenv==20.24.0" {
+		t.Error("ignored dependency should be untouched:", got)
+	}
+}
+
+// marshalPreCommitConfig() should preserve the document's original 2-space indent rather than
+// reflowing it to yaml.Marshal's default of 4, so that --fix/--dry-run produce a minimal diff.
+func TestMarshalPreCommitConfig(t *testing.T) {
+	lockfile := poetryLock{Package: []struct {
+		Name    string
+		Version string
+	}{
+		{Name: "flake8-docstrings", Version: "1.7.0"},
+	}}
+	original := []byte(`repos:
+  - repo: https://github.com/pycqa/flake8
+    rev: 7.0.0
+    hooks:
+      - id: flake8
+        additional_dependencies:
+          - flake8-docstrings==1.6.0
+`)
+	root, err := loadPreCommitConfig(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fixVersions(root, lockfile, []string{"flake8"}, nil) {
+		t.Fatal("expected a fix to be made")
+	}
+	fixed, err := marshalPreCommitConfig(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `repos:
+  - repo: https://github.com/pycqa/flake8
+    rev: 7.0.0
+    hooks:
+      - id: flake8
+        additional_dependencies:
+          - flake8-docstrings==1.7.0
+`
+	if string(fixed) != want {
+		t.Errorf("got:\n%s\nwanted:\n%s", fixed, want)
+	}
+}
+
+// When passed no config file, loadConfigFile() should return a zero-value config and no error.
+func TestLoadConfigFileMissing(t *testing.T) {
+	config, err := loadConfigFile(fstest.MapFS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Check) != 0 {
+		t.Error("expected no checks:", config.Check)
+	}
+}
+
+// When passed a valid config file, loadConfigFile() should parse its [[check]] entries.
+func TestLoadConfigFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		configFileName: &fstest.MapFile{Data: []byte(`
+[[check]]
+hook_id = "flake8*"
+lockfile = "subdir/poetry.lock"
+ignore = ["flake8-meta"]
+
+[[check]]
+hook_id = "mypy"
+pyproject = "pyproject.toml"
+`)},
+	}
+	config, err := loadConfigFile(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Check) != 2 {
+		t.Fatal("wrong number of checks:", config.Check)
+	}
+	if config.Check[0].HookID != "flake8*" || config.Check[0].Lockfile != "subdir/poetry.lock" ||
+		!slices.Equal(config.Check[0].Ignore, []string{"flake8-meta"}) {
+		t.Error("wrong first check:", config.Check[0])
+	}
+	if config.Check[1].HookID != "mypy" || config.Check[1].Pyproject != "pyproject.toml" {
+		t.Error("wrong second check:", config.Check[1])
+	}
+}
+
+// matchingHookIds() should match an exact hook ID or a glob, normalizing both sides.
+func TestMatchingHookIds(t *testing.T) {
+	root, err := loadPreCommitConfig([]byte(`repos:
+- hooks:
+  - id: flake8-docstrings
+  - id: flake8_typing.imports
+  - id: mypy
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config preCommitConfig
+	if err := root.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"mypy", []string{"mypy"}},
+		{"flake8*", []string{"flake8-docstrings", "flake8_typing.imports"}},
+		{"does-not-exist", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			got := matchingHookIds(config, test.pattern)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+// filterIgnored() should drop only the additional_dependencies entries naming an ignored package.
+func TestFilterIgnored(t *testing.T) {
+	root, err := loadPreCommitConfig([]byte(`repos:
+- hooks:
+  - id: flake8
+    additional_dependencies: [flake8-docstrings==1.7.0, virtualenv==20.25.0]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config preCommitConfig
+	if err := root.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	filtered := filterIgnored(config, []string{"FLAKE8-DocStrings"})
+	got := filtered.Repos[0].Hooks[0].AdditionalDependencies
+	want := []string{"virtualenv==20.25.0"}
+	if !slices.Equal(got, want) {
+		t.Error("incorrect filtered deps:", got)
+	}
+}
+
 func TestNormalizeName(t *testing.T) {
 	tests := []struct {
 		in   string
@@ -216,3 +755,95 @@ func TestNormalizeName(t *testing.T) {
 		})
 	}
 }
+
+// loadPyprojectConstraints() should parse Poetry-style, PEP 621 and PEP 621 optional-dependency
+// constraints, normalizing names and skipping the "python" entry.
+func TestLoadPyprojectConstraints(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pyproject.toml": &fstest.MapFile{Data: []byte(`
+[tool.poetry.dependencies]
+python = "^3.11"
+requests = "^2.31.0"
+flake8-docstrings = {version = "1.7.0", optional = true}
+
+[project]
+dependencies = ["click>=8,<9"]
+
+[project.optional-dependencies]
+test = ["pytest~=7.4"]
+`)},
+	}
+	constraints, err := loadPyprojectConstraints(fsys, "pyproject.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"requests":          ">=2.31.0,<3.0.0",
+		"flake8-docstrings": ">=1.7.0,<2.0.0",
+		"click":             ">=8,<9",
+		"pytest":            "~=7.4",
+	}
+	if len(constraints) != len(want) {
+		t.Fatalf("got %v want %v", constraints, want)
+	}
+	for name, spec := range want {
+		if constraints[name] != spec {
+			t.Errorf("%v: got %q want %q", name, constraints[name], spec)
+		}
+	}
+}
+
+// poetryConstraintToPEP440() should translate Poetry's caret/tilde/bare-version shorthand into
+// PEP 440 ranges, and pass already-PEP-440 constraints through unchanged.
+func TestPoetryConstraintToPEP440(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"^2.31.0", ">=2.31.0,<3.0.0"},
+		{"^0.4.1", ">=0.4.1,<0.5.0"},
+		{"^0.0.3", ">=0.0.3,<0.0.4"},
+		{"~1.2.3", ">=1.2.3,<1.3.0"},
+		{"~1", ">=1,<2"},
+		{"1.7.0", ">=1.7.0,<2.0.0"},
+		{">=2,<3", ">=2,<3"},
+		{"~=7.4", "~=7.4"},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := poetryConstraintToPEP440(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// checkPyprojectConstraints() should report pins that violate their declared pyproject.toml
+// constraint, and ignore pins with no declared constraint or that aren't exact pins.
+func TestCheckPyprojectConstraints(t *testing.T) {
+	root, err := loadPreCommitConfig([]byte(`repos:
+- hooks:
+  - id: flake8
+    additional_dependencies: [requests==1.2.3, virtualenv==20.25.0, click>=8]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config preCommitConfig
+	if err := root.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	constraints := map[string]string{
+		"requests":   ">=2,<3",
+		"virtualenv": ">=20,<21",
+	}
+	problems := checkPyprojectConstraints(config, []string{"flake8"}, constraints)
+	want := []string{"requests==1.2.3: pinned 1.2.3 violates pyproject constraint >=2,<3"}
+	if !slices.Equal(problems, want) {
+		t.Errorf("got %v want %v", problems, want)
+	}
+}